@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// configFileName — имя файла конфигурации, которое ищется во всех каталогах поиска.
+const configFileName = "config.json"
+
+// configPathEnvVar — переменная окружения, позволяющая явно указать путь к конфигурации,
+// в обход обычного поиска по каталогам.
+const configPathEnvVar = "FILE_ORGANIZER_CONFIG"
+
+// Pair описывает одну пару "исходная директория -> целевая директория" со своими
+// собственными правилами отбора файлов.
+type Pair struct {
+	SourceDir         string   `json:"source_dir"`
+	TargetDir         string   `json:"target_dir"`
+	MinFileSize       int64    `json:"min_file_size"`
+	MaxFileSize       int64    `json:"max_file_size,omitempty"`
+	IncludeGlobs      []string `json:"include_globs,omitempty"`
+	ExcludeGlobs      []string `json:"exclude_globs,omitempty"`
+	DeleteSourceAfter bool     `json:"delete_source_after"`
+	Recursive         bool     `json:"recursive"`
+	// StableForSeconds — сколько секунд размер и время изменения файла должны оставаться
+	// неизменными в режиме -daemon, прежде чем он считается "закрытым для записи". 0 — значение
+	// по умолчанию (defaultStableFor).
+	StableForSeconds int64 `json:"stable_for_seconds,omitempty"`
+	// MaxParallel — сколько файлов может переноситься в TargetDir одновременно. 0 — значение
+	// по умолчанию (defaultMaxParallel), обычно достаточное для SMB-шар; для локальных дисков
+	// имеет смысл указывать больше.
+	MaxParallel int `json:"max_parallel,omitempty"`
+	// MaxBytesPerSec ограничивает суммарную скорость записи в TargetDir. 0 — без ограничения.
+	MaxBytesPerSec int64 `json:"max_bytes_per_sec,omitempty"`
+	// MinFreeBytes — запас свободного места на TargetDir сверх суммарного размера подходящих
+	// файлов источника, без которого предполётная проверка отклонит пару.
+	MinFreeBytes int64 `json:"min_free_bytes,omitempty"`
+}
+
+// Config структура для хранения настроек.
+type Config struct {
+	Pairs []Pair `json:"pairs"`
+	// LogRetention задаёт срок хранения ротированных лог-файлов в формате "годы-месяцы-дни".
+	LogRetention string `json:"log_retention"`
+	// LogMaxSizeMB — размер events.jsonl, по достижении которого он ротируется.
+	LogMaxSizeMB int64 `json:"log_max_size_mb"`
+}
+
+// legacyConfig — формат конфигурации с параллельными списками директорий, использовавшийся
+// до введения Pair. Хранится только для миграции старых файлов конфигурации.
+type legacyConfig struct {
+	SourceDirs  []string `json:"source_dirs"`
+	TargetDirs  []string `json:"target_dirs"`
+	MinFileSize int64    `json:"min_file_size"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		LogRetention: "0-1-0",
+		LogMaxSizeMB: 50,
+		Pairs: []Pair{
+			{
+				SourceDir:         "e:/FilesNota/572149/1",
+				TargetDir:         "//192.168.2.15/5/test/1",
+				MinFileSize:       26463150,
+				DeleteSourceAfter: true,
+				Recursive:         true,
+			},
+			{
+				SourceDir:         "e:/FilesNota/572149/2",
+				TargetDir:         "//192.168.2.15/5/test/2",
+				MinFileSize:       26463150,
+				DeleteSourceAfter: true,
+				Recursive:         true,
+			},
+		},
+	}
+}
+
+// resolveConfigPath определяет, какой файл конфигурации использовать. Порядок приоритета:
+// флаг -config, переменная окружения FILE_ORGANIZER_CONFIG, затем поиск config.json по
+// списку стандартных каталогов (аналогично Mattermost FindConfigFile). Если файл нигде не
+// найден, возвращается путь в текущей директории — туда будет записана конфигурация по
+// умолчанию.
+func resolveConfigPath(configFlag string) string {
+	if configFlag != "" {
+		return configFlag
+	}
+	if envPath := os.Getenv(configPathEnvVar); envPath != "" {
+		return envPath
+	}
+	for _, dir := range configSearchDirs() {
+		candidate := filepath.Join(dir, configFileName)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return filepath.Join(".", configFileName)
+}
+
+// configSearchDirs возвращает упорядоченный список каталогов, в которых ищется config.json:
+// текущая директория, $XDG_CONFIG_HOME/file-organizer (или ~/.config/file-organizer),
+// директория исполняемого файла и системный каталог конфигурации (/etc/file-organizer на
+// Unix, %PROGRAMDATA%\file-organizer на Windows).
+func configSearchDirs() []string {
+	dirs := []string{"."}
+
+	if xdgHome := os.Getenv("XDG_CONFIG_HOME"); xdgHome != "" {
+		dirs = append(dirs, filepath.Join(xdgHome, "file-organizer"))
+	} else if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".config", "file-organizer"))
+	}
+
+	if exe, err := os.Executable(); err == nil {
+		dirs = append(dirs, filepath.Dir(exe))
+	}
+
+	dirs = append(dirs, systemConfigDir())
+
+	return dirs
+}
+
+// loadOrCreateConfig загружает настройки из указанного файла или создаёт файл с настройками
+// по умолчанию, если файл отсутствует. Если найден файл в старом формате (параллельные
+// списки source_dirs/target_dirs), он преобразуется в []Pair и перезаписывается на диске
+// в новом формате.
+func loadOrCreateConfig(path string) (*Config, error) {
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		config := defaultConfig()
+		if err := writeConfig(path, config); err != nil {
+			return nil, err
+		}
+		return config, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("ошибка при открытии файла конфигурации: %v", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return nil, fmt.Errorf("ошибка при чтении файла конфигурации: %v", err)
+	}
+	if len(config.Pairs) > 0 {
+		return &config, nil
+	}
+
+	// Новый формат не распознан или пуст — пробуем старый формат с параллельными списками.
+	var legacy legacyConfig
+	if err := json.Unmarshal(raw, &legacy); err != nil {
+		return nil, fmt.Errorf("ошибка при чтении файла конфигурации: %v", err)
+	}
+	if len(legacy.SourceDirs) == 0 {
+		return &config, nil
+	}
+
+	migrated, err := migrateLegacyConfig(&legacy)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при миграции файла конфигурации: %v", err)
+	}
+	if err := writeConfig(path, migrated); err != nil {
+		return nil, err
+	}
+	return migrated, nil
+}
+
+// migrateLegacyConfig преобразует старый формат с параллельными списками SourceDirs/
+// TargetDirs в []Pair. В старом формате несовпадение длин списков приводило к панике при
+// обращении по индексу — здесь это явная ошибка.
+func migrateLegacyConfig(legacy *legacyConfig) (*Config, error) {
+	if len(legacy.SourceDirs) != len(legacy.TargetDirs) {
+		return nil, fmt.Errorf("source_dirs и target_dirs разной длины: %d и %d", len(legacy.SourceDirs), len(legacy.TargetDirs))
+	}
+
+	pairs := make([]Pair, len(legacy.SourceDirs))
+	for i, sourceDir := range legacy.SourceDirs {
+		pairs[i] = Pair{
+			SourceDir:         sourceDir,
+			TargetDir:         legacy.TargetDirs[i],
+			MinFileSize:       legacy.MinFileSize,
+			DeleteSourceAfter: true,
+			Recursive:         true,
+		}
+	}
+	return &Config{
+		LogRetention: "0-1-0",
+		LogMaxSizeMB: 50,
+		Pairs:        pairs,
+	}, nil
+}
+
+// writeConfig сериализует конфигурацию и записывает её по указанному пути, создавая
+// родительскую директорию при необходимости.
+func writeConfig(path string, config *Config) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("не удалось создать директорию конфигурации: %v", err)
+		}
+	}
+	prettyJSON, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("не удалось форматировать настройки: %v", err)
+	}
+	if err := os.WriteFile(path, prettyJSON, 0644); err != nil {
+		return fmt.Errorf("не удалось записать настройки: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build unix
+
+package main
+
+// systemConfigDir возвращает системную директорию конфигурации на Unix-подобных системах.
+func systemConfigDir() string {
+	return "/etc/file-organizer"
+}
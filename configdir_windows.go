@@ -0,0 +1,14 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// systemConfigDir возвращает системную директорию конфигурации на Windows
+// (%PROGRAMDATA%\file-organizer).
+func systemConfigDir() string {
+	return filepath.Join(os.Getenv("PROGRAMDATA"), "file-organizer")
+}
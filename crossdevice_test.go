@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ittehid/File-Organizer/internal/logger"
+)
+
+func TestIsCrossDeviceError(t *testing.T) {
+	crossDevice := &os.LinkError{Op: "rename", Old: "a", New: "b", Err: crossDeviceErrno}
+	if !isCrossDeviceError(crossDevice) {
+		t.Error("isCrossDeviceError(crossDevice) = false, want true")
+	}
+
+	otherErrno := &os.LinkError{Op: "rename", Old: "a", New: "b", Err: os.ErrPermission}
+	if isCrossDeviceError(otherErrno) {
+		t.Error("isCrossDeviceError(otherErrno) = true, want false")
+	}
+
+	if isCrossDeviceError(os.ErrNotExist) {
+		t.Error("isCrossDeviceError(os.ErrNotExist) = true, want false")
+	}
+}
+
+// TestMoveFileFallsBackToCopyOnCrossDevice подменяет osRename так, чтобы быстрый путь всегда
+// возвращал EXDEV, и проверяет, что moveFile откатывается на копирование через временный файл
+// и всё равно корректно переносит содержимое.
+func TestMoveFileFallsBackToCopyOnCrossDevice(t *testing.T) {
+	dir := t.TempDir()
+	sourcePath := filepath.Join(dir, "source.bin")
+	targetPath := filepath.Join(dir, "target.bin")
+	content := []byte("test-content")
+	if err := os.WriteFile(sourcePath, content, 0644); err != nil {
+		t.Fatalf("WriteFile(source) failed: %v", err)
+	}
+
+	original := osRename
+	osRename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: crossDeviceErrno}
+	}
+	defer func() { osRename = original }()
+
+	lg, err := logger.New(t.TempDir(), logger.Retention{}, 0, io.Discard)
+	if err != nil {
+		t.Fatalf("logger.New failed: %v", err)
+	}
+	defer lg.Close()
+
+	if err := moveFile(sourcePath, targetPath, true, nil, lg); err != nil {
+		t.Fatalf("moveFile failed: %v", err)
+	}
+
+	got, err := os.ReadFile(targetPath)
+	if err != nil {
+		t.Fatalf("ReadFile(target) failed: %v", err)
+	}
+	if string(got) != string(content) {
+		t.Errorf("target content = %q, want %q", got, content)
+	}
+	if _, err := os.Stat(sourcePath); !os.IsNotExist(err) {
+		t.Errorf("source file still exists after move, stat err = %v", err)
+	}
+}
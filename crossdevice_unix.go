@@ -0,0 +1,9 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// crossDeviceErrno — код ошибки ядра, который os.Rename возвращает, когда источник и
+// цель находятся на разных файловых системах (нельзя переименовать, нужно копировать).
+const crossDeviceErrno = syscall.EXDEV
@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+import "syscall"
+
+// crossDeviceErrno — код ошибки Windows (ERROR_NOT_SAME_DEVICE), который MoveFile
+// возвращает вместо EXDEV, когда источник и цель находятся на разных томах.
+const crossDeviceErrno = syscall.Errno(17)
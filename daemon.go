@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/ittehid/File-Organizer/internal/logger"
+)
+
+// defaultStableFor — срок по умолчанию, в течение которого размер и mtime файла должны
+// оставаться неизменными, прежде чем он считается закрытым сторонним писателем.
+const defaultStableFor = 5 * time.Second
+
+// watchRetryInterval — как часто демон повторно пытается начать наблюдение за SourceDir пар,
+// для которых это не удалось при запуске (например, сетевая шара ещё не смонтирована или
+// видеорегистратор ещё не создал свою папку).
+const watchRetryInterval = time.Minute
+
+// stableForDuration возвращает настроенный для пары интервал стабильности или defaultStableFor,
+// если StableForSeconds не задан.
+func (p Pair) stableForDuration() time.Duration {
+	if p.StableForSeconds <= 0 {
+		return defaultStableFor
+	}
+	return time.Duration(p.StableForSeconds) * time.Second
+}
+
+// runDaemon наблюдает за всеми сконфигурированными исходными директориями через fsnotify и
+// переносит файлы по мере того, как они становятся стабильными (StableFor без изменения
+// размера и mtime), вместо однократного обхода. SIGINT/SIGTERM запускает плавное завершение:
+// наблюдение останавливается, но уже запущенные переносы успевают закончиться.
+func runDaemon(config *Config, lg *logger.Logger) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("не удалось создать fsnotify watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	pools := make(map[string]*pairWorkerPool, len(config.Pairs))
+	unwatched := make(map[string]Pair)
+	for _, pair := range config.Pairs {
+		if err := addWatchRecursive(watcher, pair.SourceDir, pair.Recursive); err != nil {
+			lg.Error("Не удалось начать наблюдение за директорией, попробуем снова позже", logger.Src(pair.SourceDir), logger.Err(err))
+			unwatched[pair.SourceDir] = pair
+		}
+		pools[pair.SourceDir] = newPairWorkerPool(pair, lg)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	retentionTicker := time.NewTicker(retentionSweepInterval)
+	defer retentionTicker.Stop()
+
+	watchRetryTicker := time.NewTicker(watchRetryInterval)
+	defer watchRetryTicker.Stop()
+
+	pending := newPendingSet()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				closePools(pools)
+				return nil
+			}
+			handleWatchEvent(event, config, watcher, pending, pools, lg)
+
+		case werr, ok := <-watcher.Errors:
+			if !ok {
+				closePools(pools)
+				return nil
+			}
+			lg.Error("Ошибка fsnotify", logger.Err(werr))
+
+		case <-retentionTicker.C:
+			lg.CleanOldLogs()
+
+		case <-watchRetryTicker.C:
+			retryUnwatched(watcher, unwatched, lg)
+
+		case <-sigCh:
+			lg.Info("Получен сигнал завершения, ожидание незавершённых переносов")
+			pending.stop()
+			closePools(pools)
+			return nil
+		}
+	}
+}
+
+// retryUnwatched повторно пытается начать наблюдение за источниками, которые были недоступны
+// при запуске демона или при предыдущей попытке, и убирает из unwatched те, что удались.
+func retryUnwatched(watcher *fsnotify.Watcher, unwatched map[string]Pair, lg *logger.Logger) {
+	for sourceDir, pair := range unwatched {
+		if err := addWatchRecursive(watcher, pair.SourceDir, pair.Recursive); err != nil {
+			continue
+		}
+		lg.Info("Наблюдение за директорией успешно начато", logger.Src(pair.SourceDir))
+		delete(unwatched, sourceDir)
+	}
+}
+
+// closePools закрывает очереди всех пулов воркеров и дожидается завершения уже начатых
+// переносов.
+func closePools(pools map[string]*pairWorkerPool) {
+	for _, pool := range pools {
+		pool.Close()
+	}
+}
+
+// handleWatchEvent обрабатывает одно fsnotify-событие: для новых и изменённых файлов
+// запускает (или перезапускает) отсчёт стабильности, для новых директорий добавляет
+// наблюдение рекурсивно.
+func handleWatchEvent(event fsnotify.Event, config *Config, watcher *fsnotify.Watcher, pending *pendingSet, pools map[string]*pairWorkerPool, lg *logger.Logger) {
+	if event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+		return
+	}
+
+	info, err := os.Stat(event.Name)
+	if err != nil {
+		return
+	}
+	if info.IsDir() {
+		// Вложенная директория наблюдается дальше, только если пара, которой она принадлежит,
+		// имеет Recursive == true — иначе поведение демона разошлось бы с обычным проходом,
+		// где walkTopLevel не спускается во вложенные директории вовсе.
+		if event.Op&fsnotify.Create != 0 {
+			if pair, ok := pairForPath(config, event.Name); ok && pair.Recursive {
+				_ = addWatchRecursive(watcher, event.Name, true)
+			}
+		}
+		return
+	}
+
+	pair, ok := pairForPath(config, event.Name)
+	if !ok {
+		return
+	}
+
+	baseline := fileStatOf(info)
+	stableFor := pair.stableForDuration()
+	pending.schedule(event.Name, stableFor, func() {
+		checkStability(event.Name, baseline, pair, stableFor, pending, pools[pair.SourceDir], lg)
+	})
+}
+
+// checkStability перечитывает метаданные path и сравнивает их с baseline. Если что-то
+// изменилось, отсчёт стабильности перезапускается с новым baseline; если нет — файл считается
+// закрытым для записи, проверяется на соответствие правилам пары и отправляется в пул
+// воркеров пары.
+func checkStability(path string, baseline fileStat, pair Pair, stableFor time.Duration, pending *pendingSet, pool *pairWorkerPool, lg *logger.Logger) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	current := fileStatOf(info)
+	if current != baseline {
+		pending.schedule(path, stableFor, func() {
+			checkStability(path, current, pair, stableFor, pending, pool, lg)
+		})
+		return
+	}
+
+	if !pairMatches(pair, info) {
+		return
+	}
+
+	pool.Submit(moveJob{path: path, info: info})
+}
+
+// fileStat — слепок размера и времени изменения файла, используемый для определения,
+// закончилась ли запись в него.
+type fileStat struct {
+	size  int64
+	mtime time.Time
+}
+
+func fileStatOf(info os.FileInfo) fileStat {
+	return fileStat{size: info.Size(), mtime: info.ModTime()}
+}
+
+// addWatchRecursive добавляет root под наблюдение watcher. Если recursive, в наблюдение
+// рекурсивно включаются и все поддиректории root — fsnotify не умеет следить за деревом
+// директорий целиком, поэтому каждая добавляется по отдельности; если нет, наблюдение
+// ограничивается самим root, как и обычный проход через walkTopLevel для Recursive == false.
+func addWatchRecursive(watcher *fsnotify.Watcher, root string, recursive bool) error {
+	if !recursive {
+		return watcher.Add(root)
+	}
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+// pairForPath находит пару, исходная директория которой содержит path, с учётом Pair.Recursive:
+// для Recursive == false подходят только файлы непосредственно в SourceDir, без вложенных
+// поддиректорий, — так же, как их отбирает walkTopLevel в batch-режиме.
+func pairForPath(config *Config, path string) (Pair, bool) {
+	for _, pair := range config.Pairs {
+		if isWithin(pair.SourceDir, path, pair.Recursive) {
+			return pair, true
+		}
+	}
+	return Pair{}, false
+}
+
+// isWithin сообщает, находится ли path внутри директории root. Если recursive == false, path
+// должен быть непосредственным содержимым root, а не лежать во вложенной поддиректории.
+func isWithin(root, path string, recursive bool) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return false
+	}
+	if recursive {
+		return true
+	}
+	return !strings.Contains(rel, string(os.PathSeparator))
+}
+
+// pendingSet хранит по одному таймеру отсчёта стабильности на файл, перезапуская его при
+// повторных событиях записи вместо того, чтобы копить дубликаты.
+type pendingSet struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func newPendingSet() *pendingSet {
+	return &pendingSet{timers: make(map[string]*time.Timer)}
+}
+
+// schedule (пере)запускает таймер для path: fn выполнится через after, если до этого не будет
+// вызван schedule с тем же путём снова.
+func (p *pendingSet) schedule(path string, after time.Duration, fn func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if t, ok := p.timers[path]; ok {
+		t.Stop()
+	}
+	p.timers[path] = time.AfterFunc(after, func() {
+		p.mu.Lock()
+		delete(p.timers, path)
+		p.mu.Unlock()
+		fn()
+	})
+}
+
+// stop останавливает все ожидающие таймеры (используется при плавном завершении).
+func (p *pendingSet) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, t := range p.timers {
+		t.Stop()
+	}
+	p.timers = make(map[string]*time.Timer)
+}
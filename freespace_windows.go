@@ -0,0 +1,20 @@
+//go:build windows
+
+package main
+
+import "golang.org/x/sys/windows"
+
+// freeSpace возвращает объём свободного места, доступного вызывающему пользователю на томе,
+// содержащем path (через GetDiskFreeSpaceExW).
+func freeSpace(path string) (uint64, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var freeBytesAvailable, totalBytes, totalFreeBytes uint64
+	if err := windows.GetDiskFreeSpaceEx(pathPtr, &freeBytesAvailable, &totalBytes, &totalFreeBytes); err != nil {
+		return 0, err
+	}
+	return freeBytesAvailable, nil
+}
@@ -0,0 +1,236 @@
+// Package logger реализует логирование File Organizer'а: каждое событие одновременно
+// пишется человекочитаемой строкой в консоль и JSON-строкой в файл, с ротацией по размеру
+// и зачисткой устаревших файлов по сроку хранения.
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	consoleTimeFormat = "02-01-2006 15:04:05"
+	rotatedDateFormat = "02-01-2006"
+	jsonFileName      = "events.jsonl"
+)
+
+// Field — одно структурированное поле лог-события (src, dst, bytes, duration_ms, err).
+type Field struct {
+	key   string
+	value interface{}
+}
+
+func Src(v string) Field             { return Field{"src", v} }
+func Dst(v string) Field             { return Field{"dst", v} }
+func Bytes(v int64) Field            { return Field{"bytes", v} }
+func Duration(d time.Duration) Field { return Field{"duration_ms", d.Milliseconds()} }
+func BytesPerSec(v int64) Field      { return Field{"bytes_per_sec", v} }
+
+func Err(err error) Field {
+	if err == nil {
+		return Field{"err", ""}
+	}
+	return Field{"err", err.Error()}
+}
+
+// entry — одна строка JSON-лога.
+type entry struct {
+	Ts          string `json:"ts"`
+	Level       string `json:"level"`
+	Event       string `json:"event"`
+	Src         string `json:"src,omitempty"`
+	Dst         string `json:"dst,omitempty"`
+	Bytes       int64  `json:"bytes,omitempty"`
+	DurationMs  int64  `json:"duration_ms,omitempty"`
+	BytesPerSec int64  `json:"bytes_per_sec,omitempty"`
+	Err         string `json:"err,omitempty"`
+}
+
+// Logger пишет каждое событие одновременно человекочитаемой строкой в консоль и JSON-строкой
+// в файл jsonFileName внутри dir, ротируя файл при превышении maxSizeMB и зачищая файлы
+// старше retention при вызове CleanOldLogs.
+type Logger struct {
+	mu        sync.Mutex
+	dir       string
+	console   io.Writer
+	file      *os.File
+	maxBytes  int64
+	retention Retention
+}
+
+// New создаёт логгер, пишущий в dir/events.jsonl. maxSizeMB <= 0 отключает ротацию по размеру.
+func New(dir string, retention Retention, maxSizeMB int64, console io.Writer) (*Logger, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("не удалось создать директорию логов: %v", err)
+	}
+	file, err := os.OpenFile(filepath.Join(dir, jsonFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть файл логов: %v", err)
+	}
+
+	var maxBytes int64
+	if maxSizeMB > 0 {
+		maxBytes = maxSizeMB * 1024 * 1024
+	}
+
+	return &Logger{
+		dir:       dir,
+		console:   console,
+		file:      file,
+		maxBytes:  maxBytes,
+		retention: retention,
+	}, nil
+}
+
+// Close закрывает файл логов.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Info пишет информационное событие.
+func (l *Logger) Info(event string, fields ...Field) {
+	l.write("INFO", event, fields)
+}
+
+// Error пишет событие об ошибке.
+func (l *Logger) Error(event string, fields ...Field) {
+	l.write("ERROR", event, fields)
+}
+
+// Fatal пишет событие о неустранимой ошибке для одной пары источник/цель. В отличие от
+// традиционного log.Fatal не завершает программу — вызывающий код сам решает, продолжать ли
+// работу с оставшимися парами.
+func (l *Logger) Fatal(event string, fields ...Field) {
+	l.write("FATAL", event, fields)
+}
+
+func (l *Logger) write(level, event string, fields []Field) {
+	e := entry{Ts: time.Now().Format(time.RFC3339), Level: level, Event: event}
+	for _, f := range fields {
+		switch f.key {
+		case "src":
+			e.Src, _ = f.value.(string)
+		case "dst":
+			e.Dst, _ = f.value.(string)
+		case "bytes":
+			e.Bytes, _ = f.value.(int64)
+		case "duration_ms":
+			e.DurationMs, _ = f.value.(int64)
+		case "bytes_per_sec":
+			e.BytesPerSec, _ = f.value.(int64)
+		case "err":
+			e.Err, _ = f.value.(string)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	fmt.Fprintln(l.console, consoleLine(e))
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		fmt.Fprintf(l.console, "%s: [ERROR] не удалось сериализовать запись лога: %v\n", time.Now().Format(consoleTimeFormat), err)
+		return
+	}
+	line = append(line, '\n')
+	if _, err := l.file.Write(line); err != nil {
+		fmt.Fprintf(l.console, "%s: [ERROR] не удалось записать лог: %v\n", time.Now().Format(consoleTimeFormat), err)
+		return
+	}
+
+	if l.maxBytes > 0 {
+		if info, err := l.file.Stat(); err == nil && info.Size() >= l.maxBytes {
+			l.rotateLocked()
+		}
+	}
+}
+
+// consoleLine строит человекочитаемую строку для консоли: метка времени, уровень в квадратных
+// скобках, событие и непустые поля в виде key=value.
+func consoleLine(e entry) string {
+	line := fmt.Sprintf("%s: [%s] %s", time.Now().Format(consoleTimeFormat), e.Level, e.Event)
+	if e.Src != "" {
+		line += fmt.Sprintf(" src=%s", e.Src)
+	}
+	if e.Dst != "" {
+		line += fmt.Sprintf(" dst=%s", e.Dst)
+	}
+	if e.Bytes != 0 {
+		line += fmt.Sprintf(" bytes=%d", e.Bytes)
+	}
+	if e.DurationMs != 0 {
+		line += fmt.Sprintf(" duration_ms=%d", e.DurationMs)
+	}
+	if e.BytesPerSec != 0 {
+		line += fmt.Sprintf(" bytes_per_sec=%d", e.BytesPerSec)
+	}
+	if e.Err != "" {
+		line += fmt.Sprintf(" err=%s", e.Err)
+	}
+	return line
+}
+
+// rotateLocked переименовывает текущий файл логов в "02-01-2006-N.log" и открывает новый
+// пустой events.jsonl. Вызывающий должен удерживать l.mu.
+func (l *Logger) rotateLocked() {
+	if err := l.file.Close(); err != nil {
+		fmt.Fprintf(l.console, "%s: [ERROR] не удалось закрыть файл логов перед ротацией: %v\n", time.Now().Format(consoleTimeFormat), err)
+		return
+	}
+
+	date := time.Now().Format(rotatedDateFormat)
+	for n := 1; ; n++ {
+		rotatedPath := filepath.Join(l.dir, fmt.Sprintf("%s-%d.log", date, n))
+		if _, err := os.Stat(rotatedPath); os.IsNotExist(err) {
+			if err := os.Rename(filepath.Join(l.dir, jsonFileName), rotatedPath); err != nil {
+				fmt.Fprintf(l.console, "%s: [ERROR] не удалось переименовать файл логов при ротации: %v\n", time.Now().Format(consoleTimeFormat), err)
+			}
+			break
+		}
+	}
+
+	file, err := os.OpenFile(filepath.Join(l.dir, jsonFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintf(l.console, "%s: [ERROR] не удалось открыть новый файл логов после ротации: %v\n", time.Now().Format(consoleTimeFormat), err)
+		return
+	}
+	l.file = file
+}
+
+// CleanOldLogs удаляет ротированные файлы логов старше срока хранения l.retention. Активный
+// events.jsonl никогда не удаляется.
+func (l *Logger) CleanOldLogs() {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		l.Error("Не удалось прочитать директорию логов", Err(err))
+		return
+	}
+
+	cutoff := l.retention.Cutoff(time.Now())
+	for _, e := range entries {
+		if e.IsDir() || e.Name() == jsonFileName {
+			continue
+		}
+		path := filepath.Join(l.dir, e.Name())
+		info, err := e.Info()
+		if err != nil {
+			l.Error("Не удалось получить информацию о файле лога", Src(path), Err(err))
+			continue
+		}
+		if info.ModTime().Before(cutoff) {
+			if err := os.Remove(path); err != nil {
+				l.Error("Не удалось удалить старый лог-файл", Src(path), Err(err))
+			} else {
+				l.Info("Удалён старый лог-файл", Src(path))
+			}
+		}
+	}
+}
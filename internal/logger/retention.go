@@ -0,0 +1,40 @@
+package logger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retention описывает срок хранения лог-файлов в формате "годы-месяцы-дни", как в настройках
+// логгера lowcodeplatform.
+type Retention struct {
+	Years  int
+	Months int
+	Days   int
+}
+
+// ParseRetention разбирает строку вида "0-1-0" (0 лет, 1 месяц, 0 дней).
+func ParseRetention(s string) (Retention, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 3 {
+		return Retention{}, fmt.Errorf("неверный формат срока хранения %q, ожидается \"годы-месяцы-дни\"", s)
+	}
+
+	values := make([]int, 3)
+	for i, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil {
+			return Retention{}, fmt.Errorf("неверный формат срока хранения %q: %v", s, err)
+		}
+		values[i] = v
+	}
+
+	return Retention{Years: values[0], Months: values[1], Days: values[2]}, nil
+}
+
+// Cutoff возвращает момент времени, раньше которого файлы считаются устаревшими относительно from.
+func (r Retention) Cutoff(from time.Time) time.Time {
+	return from.AddDate(-r.Years, -r.Months, -r.Days)
+}
@@ -1,212 +1,413 @@
 package main
 
 import (
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"syscall"
 	"time"
-)
 
-// Config структура для хранения настроек
-type Config struct {
-	SourceDirs  []string `json:"source_dirs"`
-	TargetDirs  []string `json:"target_dirs"`
-	MinFileSize int64    `json:"min_file_size"`
-}
+	"golang.org/x/time/rate"
+
+	"github.com/ittehid/File-Organizer/internal/logger"
+)
 
 const (
-	defaultConfigFile = "config.json"
-	logDir            = "logs"
-	logFileNameFormat = "02-01-2006.log"
-	logRetentionDays  = 5
+	logDir                 = "logs"
+	tmpFileNameFormat      = ".%s.part%d.tmp"
+	retentionSweepInterval = 24 * time.Hour
 )
 
+var tmpFileNameRegexp = regexp.MustCompile(`^\.(.+)\.part\d+\.tmp$`)
+
+// osRename — точка подмены os.Rename для быстрого пути moveFile, чтобы в тестах можно было
+// без реальных двух файловых систем форсировать EXDEV и проверить откат на копирование.
+var osRename = os.Rename
+
 func main() {
+	configFlag := flag.String("config", "", "путь к файлу конфигурации (переопределяет поиск по стандартным каталогам)")
+	daemonFlag := flag.Bool("daemon", false, "вместо одного прохода наблюдать за исходными директориями через fsnotify, периодически чистить устаревшие логи")
+	flag.Parse()
+
 	// Загрузка или создание конфигурации
-	config, err := loadOrCreateConfig(defaultConfigFile)
+	configPath := resolveConfigPath(*configFlag)
+	config, err := loadOrCreateConfig(configPath)
 	if err != nil {
 		fmt.Printf("Ошибка при загрузке конфигурации: %v\n", err)
 		return
 	}
 
-	// Подготовка лог-файла
-	logFile, err := setupLogFile()
+	retention, err := logger.ParseRetention(config.LogRetention)
+	if err != nil {
+		fmt.Printf("Ошибка в настройках срока хранения логов: %v\n", err)
+		return
+	}
+
+	lg, err := logger.New(logDir, retention, config.LogMaxSizeMB, os.Stdout)
 	if err != nil {
-		fmt.Printf("Ошибка при создании лог-файла: %v\n", err)
+		fmt.Printf("Ошибка при создании логгера: %v\n", err)
 		return
 	}
-	defer logFile.Close()
-	logger := io.MultiWriter(os.Stdout, logFile)
+	defer lg.Close()
 
-	log(logger, "[INFO] Программа запущена")
-	cleanOldLogs(logger)
+	lg.Info("Программа запущена")
+	lg.CleanOldLogs()
+	config.Pairs = validPairs(config, lg)
+	recoverPartialMoves(config, lg)
 
-	for i, sourceDir := range config.SourceDirs {
-		targetDir := config.TargetDirs[i]
-		log(logger, fmt.Sprintf("Обработка исходной папки: %s", sourceDir))
+	if *daemonFlag {
+		lg.Info("Запуск в режиме демона")
+		if err := runDaemon(config, lg); err != nil {
+			lg.Error("Ошибка в режиме демона", logger.Err(err))
+		}
+	} else {
+		for _, pair := range config.Pairs {
+			lg.Info("Обработка исходной папки", logger.Src(pair.SourceDir))
 
-		err := processDirectory(sourceDir, targetDir, config.MinFileSize, logger)
-		if err != nil {
-			log(logger, fmt.Sprintf("[ERROR] Ошибка при обработке папки %s: %v", sourceDir, err))
+			if err := processDirectory(pair, lg); err != nil {
+				lg.Error("Ошибка при обработке папки", logger.Src(pair.SourceDir), logger.Err(err))
+			}
 		}
 	}
 
-	log(logger, "[INFO] Программа завершена")
+	lg.Info("Программа завершена")
 }
 
-// loadOrCreateConfig загружает настройки из указанного файла или создаёт файл с настройками по умолчанию, если файл отсутствует.
-// Если файл конфигурации существует, он считывается и преобразуется в структуру Config.
-// Если файл отсутствует, создаётся файл с настройками по умолчанию, записывается на диск и возвращается структура Config с этими настройками.
-func loadOrCreateConfig(path string) (*Config, error) {
-	// Настройки по умолчанию
-	defaultConfig := &Config{
-		SourceDirs:  []string{"e:/FilesNota/572149/1", "e:/FilesNota/572149/2"},
-		TargetDirs:  []string{"//192.168.2.15/5/test/1", "//192.168.2.15/5/test/2"},
-		MinFileSize: 26463150,
-	}
-
-	// Попытка открыть файл конфигурации
-	file, err := os.Open(path)
-	if os.IsNotExist(err) {
-		// Если файл не существует, создаётся новый файл с настройками по умолчанию
-		file, err := os.Create(path)
+// processDirectory выполняет обход директории pair.SourceDir (рекурсивно, если pair.Recursive),
+// находит файлы, которые соответствуют условиям пары (размер в диапазоне MinFileSize..MaxFileSize
+// и соответствие IncludeGlobs/ExcludeGlobs), и раздаёт их пулу воркеров пары для переноса в
+// pair.TargetDir (ограниченному Pair.MaxParallel и, если задан, Pair.MaxBytesPerSec).
+func processDirectory(pair Pair, lg *logger.Logger) error {
+	walk := filepath.Walk
+	if !pair.Recursive {
+		walk = walkTopLevel
+	}
+
+	pool := newPairWorkerPool(pair, lg)
+
+	walkErr := walk(pair.SourceDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-			return nil, fmt.Errorf("не удалось создать файл конфигурации: %v", err)
+			return err
 		}
-		defer file.Close()
-		// Сериализация и запись настроек по умолчанию в файл
-		prettyJSON, err := json.MarshalIndent(defaultConfig, "", "  ")
-		if err != nil {
-			return nil, fmt.Errorf("не удалось форматировать настройки: %v", err)
+		if info.IsDir() || !pairMatches(pair, info) {
+			return nil
 		}
-		if _, err := file.Write(prettyJSON); err != nil {
-			return nil, fmt.Errorf("не удалось записать настройки: %v", err)
+		pool.Submit(moveJob{path: path, info: info})
+		return nil
+	})
+
+	pool.Close()
+	return walkErr
+}
+
+// walkTopLevel имитирует сигнатуру filepath.Walk, но обходит только сам каталог root и его
+// непосредственное содержимое, не спускаясь во вложенные директории. Используется для пар с
+// Recursive == false.
+func walkTopLevel(root string, fn filepath.WalkFunc) error {
+	rootInfo, err := os.Stat(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	if err := fn(root, rootInfo, nil); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return fn(root, rootInfo, err)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(root, entry.Name())
+		info, err := entry.Info()
+		if err := fn(path, info, err); err != nil {
+			return err
 		}
-		return defaultConfig, nil
-	} else if err != nil {
-		// Если ошибка не связана с отсутствием файла, она возвращается
-		return nil, fmt.Errorf("ошибка при открытии файла конфигурации: %v", err)
 	}
-	defer file.Close()
+	return nil
+}
+
+// pairMatches сообщает, подходит ли файл info под правила отбора пары: размер в диапазоне
+// MinFileSize..MaxFileSize (0 означает отсутствие верхней границы) и совпадение с
+// IncludeGlobs/ExcludeGlobs (пустой IncludeGlobs означает "любое имя").
+func pairMatches(pair Pair, info os.FileInfo) bool {
+	if info.Size() < pair.MinFileSize {
+		return false
+	}
+	if pair.MaxFileSize > 0 && info.Size() > pair.MaxFileSize {
+		return false
+	}
 
-	// Если файл существует, считываем его содержимое
-	var config Config
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
-		return nil, fmt.Errorf("ошибка при чтении файла конфигурации: %v", err)
+	if len(pair.IncludeGlobs) > 0 && !matchesAnyGlob(pair.IncludeGlobs, info.Name()) {
+		return false
 	}
-	return &config, nil
+	if matchesAnyGlob(pair.ExcludeGlobs, info.Name()) {
+		return false
+	}
+	return true
 }
 
-// setupLogFile создаёт и открывает лог-файл с именем, соответствующим текущей дате.
-// Если директория для логов отсутствует, она создаётся.
-func setupLogFile() (*os.File, error) {
-	// Создание директории для логов, если она отсутствует
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		return nil, fmt.Errorf("не удалось создать директорию для логов: %v", err)
-	}
-	// Формирование пути к лог-файлу с именем на основе текущей даты
-	logFilePath := filepath.Join(logDir, time.Now().Format(logFileNameFormat))
-	// Открытие лог-файла в режиме добавления, создания или записи
-	return os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// matchesAnyGlob сообщает, совпадает ли name хотя бы с одним из шаблонов filepath.Match.
+func matchesAnyGlob(globs []string, name string) bool {
+	for _, glob := range globs {
+		if ok, err := filepath.Match(glob, name); err == nil && ok {
+			return true
+		}
+	}
+	return false
 }
 
-// cleanOldLogs удаляет лог-файлы, которые старше определённого количества дней, и пишет об этом в текущий лог-файл.
-// Функция сначала получает список файлов в директории логов, затем проверяет дату последнего изменения каждого файла.
-// Если файл старше заданного периода (logRetentionDays), он удаляется, а информация об этом записывается в лог.
-func cleanOldLogs(logger io.Writer) {
-	files, err := os.ReadDir(logDir)
-	if err != nil {
-		log(logger, fmt.Sprintf("[ERROR] Не удалось прочитать директорию логов: %v", err))
-		return
+// moveFile перемещает файл из sourcePath в targetPath. Если deleteSource установлен, сначала
+// делается попытка быстрого os.Rename — на одном томе это мгновенная операция без копирования.
+// Если источник и цель лежат на разных файловых системах (EXDEV / ERROR_NOT_SAME_DEVICE) или
+// deleteSource не установлен, используется копирование через временный файл-спутник рядом с
+// целевым (".<имя>.partN.tmp") с синхронизацией содержимого и родительской директории на диск
+// и переименованием временного файла в целевой; после переименования целевой файл
+// перечитывается и его контрольная сумма сверяется с исходной до удаления источника. Это защищает от потери данных при обрыве
+// сети или сбое питания во время копирования больших файлов на сетевые шары вроде
+// //192.168.2.15/.... Если рядом уже лежит temp-файл от прерванной попытки, копирование
+// продолжается с места обрыва после проверки контрольной суммы уже записанного фрагмента.
+// Исходный файл удаляется только если deleteSource установлен (пары с DeleteSourceAfter
+// == false копируют файл, оставляя источник на месте). Если limiter задан, копирование через
+// временный файл придерживается его token-bucket, ограничивая скорость записи.
+func moveFile(sourcePath, targetPath string, deleteSource bool, limiter *rate.Limiter, lg *logger.Logger) error {
+	// Проверяем, существует ли целевой файл, чтобы избежать перезаписи
+	if _, err := os.Stat(targetPath); err == nil {
+		return fmt.Errorf("целевой файл уже существует: %s", targetPath)
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("ошибка при проверке целевого файла: %v", err)
 	}
 
-	cutoff := time.Now().AddDate(0, 0, -logRetentionDays)
-	for _, file := range files {
-		if file.IsDir() {
-			continue
+	if deleteSource {
+		if err := osRename(sourcePath, targetPath); err == nil {
+			lg.Info("Файл перемещен (быстрый путь, то же устройство)", logger.Src(sourcePath), logger.Dst(targetPath))
+			return nil
+		} else if !isCrossDeviceError(err) {
+			return fmt.Errorf("не удалось переместить файл: %v", err)
 		}
-		filePath := filepath.Join(logDir, file.Name())
-		info, err := os.Stat(filePath)
-		if err != nil {
-			log(logger, fmt.Sprintf("[ERROR] Не удалось получить информацию о файле %s: %v", file.Name(), err))
-			continue
-		}
-		if info.ModTime().Before(cutoff) {
-			if err := os.Remove(filePath); err != nil {
-				log(logger, fmt.Sprintf("[ERROR] Не удалось удалить старый лог-файл %s: %v", file.Name(), err))
-			} else {
-				log(logger, fmt.Sprintf("Удален старый лог-файл: %s", file.Name()))
-			}
+	}
+
+	targetDir := filepath.Dir(targetPath)
+	tmpPath := filepath.Join(targetDir, fmt.Sprintf(tmpFileNameFormat, filepath.Base(targetPath), 0))
+
+	checksum, err := copyToTemp(sourcePath, tmpPath, limiter, lg)
+	if err != nil {
+		return fmt.Errorf("ошибка при копировании во временный файл: %v", err)
+	}
+
+	if err := fsyncDir(targetDir); err != nil {
+		return fmt.Errorf("не удалось синхронизировать директорию %s: %v", targetDir, err)
+	}
+
+	if err := os.Rename(tmpPath, targetPath); err != nil {
+		return fmt.Errorf("не удалось переименовать временный файл в целевой: %v", err)
+	}
+
+	if err := fsyncDir(targetDir); err != nil {
+		return fmt.Errorf("не удалось синхронизировать директорию %s после переименования: %v", targetDir, err)
+	}
+
+	// Перечитываем записанный файл и сверяем контрольную сумму, чтобы исключить молчаливое
+	// усечение на стороне SMB-шары до удаления исходника.
+	finalChecksum, err := sha256OfFile(targetPath)
+	if err != nil {
+		return fmt.Errorf("не удалось проверить контрольную сумму целевого файла: %v", err)
+	}
+	if finalChecksum != checksum {
+		return fmt.Errorf("контрольная сумма целевого файла %s не совпадает с исходной", targetPath)
+	}
+
+	if deleteSource {
+		if err := os.Remove(sourcePath); err != nil {
+			return fmt.Errorf("не удалось удалить исходный файл после копирования: %v", err)
 		}
 	}
+
+	return nil
 }
 
-// processDirectory выполняет обход указанной директории, находит файлы, которые соответствуют условиям
-// (не являются директориями и имеют размер не менее заданного минимального значения), и перемещает их
-// в целевую директорию. Информация об успешных и неудачных операциях записывается в лог.
-func processDirectory(sourceDir, targetDir string, minFileSize int64, logger io.Writer) error {
-	return filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+// copyToTemp копирует sourcePath во временный файл tmpPath и возвращает его SHA-256.
+// Если tmpPath уже содержит фрагмент от прерванной попытки, чей размер не превышает
+// размер источника, а контрольная сумма этого фрагмента совпадает с контрольной суммой
+// такого же префикса источника, копирование продолжается с конца фрагмента, а не с нуля.
+func copyToTemp(sourcePath, tmpPath string, limiter *rate.Limiter, lg *logger.Logger) (string, error) {
+	sourceFile, err := os.Open(sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("не удалось открыть исходный файл: %v", err)
+	}
+	defer sourceFile.Close()
+
+	sourceInfo, err := sourceFile.Stat()
+	if err != nil {
+		return "", fmt.Errorf("не удалось получить информацию об исходном файле: %v", err)
+	}
+
+	hasher := sha256.New()
+	var resumeOffset int64
+	var tmpFile *os.File
+
+	if tmpInfo, err := os.Stat(tmpPath); err == nil && tmpInfo.Size() > 0 && tmpInfo.Size() <= sourceInfo.Size() {
+		ok, err := prefixChecksumMatches(sourceFile, tmpPath, tmpInfo.Size())
 		if err != nil {
-			return err
+			return "", fmt.Errorf("не удалось проверить фрагмент %s: %v", tmpPath, err)
 		}
-		if !info.IsDir() && info.Size() >= minFileSize {
-			targetPath := filepath.Join(targetDir, info.Name())
-			err := moveFile(path, targetPath)
+		if ok {
+			lg.Info("Возобновление копирования", logger.Dst(tmpPath), logger.Bytes(tmpInfo.Size()))
+			if err := primeHashFromFile(hasher, tmpPath); err != nil {
+				return "", err
+			}
+			resumeOffset = tmpInfo.Size()
+			tmpFile, err = os.OpenFile(tmpPath, os.O_WRONLY, 0644)
 			if err != nil {
-				log(logger, fmt.Sprintf("[ERROR] Ошибка при перемещении файла %s в %s: %v", path, targetPath, err))
-				return err
+				return "", fmt.Errorf("не удалось открыть фрагмент для дозаписи: %v", err)
+			}
+			if _, err := tmpFile.Seek(resumeOffset, io.SeekStart); err != nil {
+				tmpFile.Close()
+				return "", fmt.Errorf("не удалось переместиться в конец фрагмента: %v", err)
 			}
-			log(logger, fmt.Sprintf("Файл %s перемещен в %s", path, targetPath))
+		} else {
+			lg.Info("Фрагмент повреждён или устарел, копирование начнётся заново", logger.Dst(tmpPath))
 		}
-		return nil
-	})
+	}
+
+	if tmpFile == nil {
+		_ = os.Remove(tmpPath)
+		tmpFile, err = os.Create(tmpPath)
+		if err != nil {
+			return "", fmt.Errorf("не удалось создать временный файл: %v", err)
+		}
+		hasher.Reset()
+		resumeOffset = 0
+	}
+	defer tmpFile.Close()
+
+	if _, err := sourceFile.Seek(resumeOffset, io.SeekStart); err != nil {
+		return "", fmt.Errorf("не удалось переместиться в исходном файле: %v", err)
+	}
+
+	if _, err := io.Copy(io.MultiWriter(tmpFile, hasher), throttled(sourceFile, limiter)); err != nil {
+		return "", fmt.Errorf("ошибка при копировании содержимого: %v", err)
+	}
+
+	if err := tmpFile.Sync(); err != nil {
+		return "", fmt.Errorf("не удалось синхронизировать временный файл: %v", err)
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
 }
 
-// moveFile копирует файл из исходного пути в целевой, а затем удаляет исходный файл
-// только если копирование прошло успешно.
-func moveFile(sourcePath, targetPath string) error {
-	sourceFile, err := os.Open(sourcePath)
+// prefixChecksumMatches проверяет, что содержимое tmpPath совпадает с первыми n байтами sourceFile.
+func prefixChecksumMatches(sourceFile *os.File, tmpPath string, n int64) (bool, error) {
+	tmpChecksum, err := sha256OfFile(tmpPath)
 	if err != nil {
-		return fmt.Errorf("не удалось открыть исходный файл: %v", err)
+		return false, err
 	}
-	defer sourceFile.Close()
 
-	// Проверяем, существует ли целевой файл, чтобы избежать перезаписи
-	if _, err := os.Stat(targetPath); err == nil {
-		return fmt.Errorf("целевой файл уже существует: %s", targetPath)
-	} else if !os.IsNotExist(err) {
-		return fmt.Errorf("ошибка при проверке целевого файла: %v", err)
+	if _, err := sourceFile.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	prefixHasher := sha256.New()
+	if _, err := io.CopyN(prefixHasher, sourceFile, n); err != nil {
+		return false, err
 	}
 
-	targetFile, err := os.Create(targetPath)
+	return tmpChecksum == hex.EncodeToString(prefixHasher.Sum(nil)), nil
+}
+
+// primeHashFromFile прогоняет содержимое path через hasher, чтобы продолжить "роллинг" хэш
+// с того места, на котором остановилась прерванная попытка копирования.
+func primeHashFromFile(hasher io.Writer, path string) error {
+	f, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("не удалось создать целевой файл: %v", err)
+		return fmt.Errorf("не удалось открыть фрагмент для подсчёта хэша: %v", err)
 	}
-	defer targetFile.Close()
+	defer f.Close()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return fmt.Errorf("не удалось посчитать хэш фрагмента: %v", err)
+	}
+	return nil
+}
 
-	// Копирование содержимого файла
-	_, err = io.Copy(targetFile, sourceFile)
+// sha256OfFile вычисляет SHA-256 содержимого файла по указанному пути.
+func sha256OfFile(path string) (string, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("ошибка при копировании содержимого: %v", err)
+		return "", err
 	}
+	defer f.Close()
 
-	// Закрываем файлы перед удалением, чтобы освободить ресурсы
-	sourceFile.Close()
-	targetFile.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
 
-	// Удаляем исходный файл только если копирование прошло успешно
-	if err := os.Remove(sourcePath); err != nil {
-		return fmt.Errorf("не удалось удалить исходный файл после копирования: %v", err)
+// isCrossDeviceError сообщает, завершился ли os.Rename ошибкой "источник и цель на разных
+// устройствах" (EXDEV на Unix, ERROR_NOT_SAME_DEVICE на Windows), что требует отката на
+// копирование вместо переименования.
+func isCrossDeviceError(err error) bool {
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) {
+		return false
 	}
+	errno, ok := linkErr.Err.(syscall.Errno)
+	return ok && errno == crossDeviceErrno
+}
 
-	return nil
+// fsyncDir синхронизирует на диск метаданные директории (например, после rename),
+// чтобы переименование пережило сбой питания сразу после записи.
+func fsyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
 }
 
-// log записывает сообщение в указанный логгер с текущей датой и временем.
-func log(logger io.Writer, message string) {
-	timestamp := time.Now().Format("02-01-2006 15:04:05")
-	fmt.Fprintf(logger, "%s: %s\n", timestamp, message)
+// recoverPartialMoves запускается при старте программы и ищет в каждой целевой директории
+// оставшиеся от прерванных попыток temp-файлы (".<имя>.partN.tmp"). Если соответствующий
+// исходный файл всё ещё существует, копирование возобновляется; если исходника уже нет,
+// фрагмент считается устаревшим и удаляется.
+func recoverPartialMoves(config *Config, lg *logger.Logger) {
+	for _, pair := range config.Pairs {
+		limiter := newLimiter(pair)
+		entries, err := os.ReadDir(pair.TargetDir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			matches := tmpFileNameRegexp.FindStringSubmatch(entry.Name())
+			if matches == nil {
+				continue
+			}
+			originalName := matches[1]
+			tmpPath := filepath.Join(pair.TargetDir, entry.Name())
+			sourcePath := filepath.Join(pair.SourceDir, originalName)
+
+			if _, err := os.Stat(sourcePath); os.IsNotExist(err) {
+				lg.Info("Удаление устаревшего фрагмента: исходный файл не найден", logger.Src(tmpPath))
+				if err := os.Remove(tmpPath); err != nil {
+					lg.Error("Не удалось удалить устаревший фрагмент", logger.Src(tmpPath), logger.Err(err))
+				}
+				continue
+			}
+
+			targetPath := filepath.Join(pair.TargetDir, originalName)
+			lg.Info("Обнаружен незавершённый перенос, возобновление", logger.Src(sourcePath), logger.Dst(tmpPath))
+			if err := moveFile(sourcePath, targetPath, pair.DeleteSourceAfter, limiter, lg); err != nil {
+				lg.Error("Не удалось возобновить перенос", logger.Src(sourcePath), logger.Err(err))
+			}
+		}
+	}
 }
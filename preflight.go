@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ittehid/File-Organizer/internal/logger"
+)
+
+// preflightProbeFileName — имя временного файла, создаваемого в целевой директории, чтобы
+// подтвердить, что она действительно доступна для записи, а не просто смонтирована.
+const preflightProbeFileName = ".file-organizer-write-test"
+
+// validPairs выполняет предполётную проверку каждой пары: целевая директория должна
+// существовать, быть директорией (а не зависшим файлом или отвалившейся SMB-шарой), быть
+// доступной для записи и иметь достаточно свободного места для всех подходящих под правила
+// пары файлов источника плюс запас MinFreeBytes. Пары, не прошедшие проверку, логируются как
+// [FATAL] и исключаются из результата; оставшиеся пары обрабатываются как обычно.
+func validPairs(config *Config, lg *logger.Logger) []Pair {
+	valid := make([]Pair, 0, len(config.Pairs))
+	for _, pair := range config.Pairs {
+		if err := validateTarget(pair); err != nil {
+			lg.Fatal("Целевая директория не прошла предполётную проверку", logger.Src(pair.SourceDir), logger.Dst(pair.TargetDir), logger.Err(err))
+			continue
+		}
+		valid = append(valid, pair)
+	}
+	return valid
+}
+
+// validateTarget проверяет одну пару и возвращает ошибку, если её TargetDir непригоден для
+// переноса файлов.
+func validateTarget(pair Pair) error {
+	info, err := os.Stat(pair.TargetDir)
+	if err != nil {
+		return fmt.Errorf("не удалось получить информацию о целевой директории: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s не является директорией", pair.TargetDir)
+	}
+
+	if err := probeWritable(pair.TargetDir); err != nil {
+		return fmt.Errorf("целевая директория недоступна для записи: %v", err)
+	}
+
+	free, err := freeSpace(pair.TargetDir)
+	if err != nil {
+		return fmt.Errorf("не удалось получить объём свободного места: %v", err)
+	}
+
+	required, err := eligibleSourceBytes(pair)
+	if err != nil {
+		return fmt.Errorf("не удалось оценить размер исходных файлов: %v", err)
+	}
+	required += pair.MinFreeBytes
+
+	if required > 0 && free < uint64(required) {
+		return fmt.Errorf("недостаточно свободного места: доступно %d байт, требуется %d байт", free, required)
+	}
+
+	return nil
+}
+
+// probeWritable пытается создать и сразу удалить небольшой файл в dir, чтобы подтвердить, что
+// директория доступна для записи.
+func probeWritable(dir string) error {
+	probePath := filepath.Join(dir, preflightProbeFileName)
+	f, err := os.Create(probePath)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(probePath)
+}
+
+// eligibleSourceBytes суммирует размер файлов в pair.SourceDir, которые пройдут pairMatches и,
+// соответственно, будут перенесены. Отсутствующий SourceDir — не ошибка предполётной проверки:
+// источники вроде сетевых шар или папок видеорегистраторов могут появиться уже после запуска,
+// особенно в режиме -daemon, который наблюдает за ними сколь угодно долго, поэтому в этом
+// случае считается, что подходящих файлов пока 0, а не что пара непригодна.
+func eligibleSourceBytes(pair Pair) (int64, error) {
+	if _, err := os.Stat(pair.SourceDir); err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	walk := filepath.Walk
+	if !pair.Recursive {
+		walk = walkTopLevel
+	}
+
+	var total int64
+	err := walk(pair.SourceDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && pairMatches(pair, info) {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/ittehid/File-Organizer/internal/logger"
+)
+
+// defaultMaxParallel — число одновременных переносов в один TargetDir, если Pair.MaxParallel
+// не задан. Этого достаточно для большинства SMB-шар; для локальных дисков стоит указывать
+// больше в конфигурации.
+const defaultMaxParallel = 2
+
+// rateLimiterBurstFloor — минимальный размер всплеска для token-bucket лимитера, чтобы не
+// душить io.Copy до размера меньше его внутреннего буфера.
+const rateLimiterBurstFloor = 32 * 1024
+
+// moveJob — один файл, ожидающий переноса в рамках пары.
+type moveJob struct {
+	path string
+	info os.FileInfo
+}
+
+// maxParallelCount возвращает настроенный Pair.MaxParallel или defaultMaxParallel, если он
+// не задан.
+func (p Pair) maxParallelCount() int {
+	if p.MaxParallel <= 0 {
+		return defaultMaxParallel
+	}
+	return p.MaxParallel
+}
+
+// newLimiter создаёт token-bucket лимитер для пары, ограничивающий суммарную скорость записи
+// в TargetDir значением MaxBytesPerSec. Возвращает nil, если ограничение не задано.
+func newLimiter(pair Pair) *rate.Limiter {
+	if pair.MaxBytesPerSec <= 0 {
+		return nil
+	}
+	burst := int(pair.MaxBytesPerSec)
+	if burst < rateLimiterBurstFloor {
+		burst = rateLimiterBurstFloor
+	}
+	return rate.NewLimiter(rate.Limit(pair.MaxBytesPerSec), burst)
+}
+
+// limitedReader оборачивает io.Reader, придерживая чтение токен-бакетом limiter, чтобы
+// io.Copy внутри moveFile не превышал настроенную скорость.
+type limitedReader struct {
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	if n > 0 && lr.limiter != nil {
+		if werr := lr.limiter.WaitN(context.Background(), n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// throttled оборачивает r лимитером пары, если он задан; иначе возвращает r как есть.
+func throttled(r io.Reader, limiter *rate.Limiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return &limitedReader{r: r, limiter: limiter}
+}
+
+// pairWorkerPool — пул воркеров, обслуживающий перенос файлов для одной пары. Каждая пара
+// получает свою ограниченную очередь (Pair.MaxParallel воркеров) и, если задан,
+// общий token-bucket лимитер пропускной способности (Pair.MaxBytesPerSec).
+type pairWorkerPool struct {
+	pair     Pair
+	limiter  *rate.Limiter
+	lg       *logger.Logger
+	jobs     chan moveJob
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	cond     *sync.Cond
+	inFlight map[string]bool
+}
+
+// newPairWorkerPool создаёт и запускает пул воркеров для пары.
+func newPairWorkerPool(pair Pair, lg *logger.Logger) *pairWorkerPool {
+	pool := &pairWorkerPool{
+		pair:     pair,
+		limiter:  newLimiter(pair),
+		lg:       lg,
+		jobs:     make(chan moveJob),
+		inFlight: make(map[string]bool),
+	}
+	pool.cond = sync.NewCond(&pool.mu)
+	for i := 0; i < pair.maxParallelCount(); i++ {
+		pool.wg.Add(1)
+		go pool.worker()
+	}
+	return pool
+}
+
+func (pool *pairWorkerPool) worker() {
+	defer pool.wg.Done()
+	for job := range pool.jobs {
+		runMoveJob(job, pool.pair, pool.limiter, pool.lg, pool)
+	}
+}
+
+// claimTarget резервирует targetPath за вызывающим воркером, блокируясь, пока targetPath занят
+// другим воркером. Так как несколько файлов с одинаковым именем из разных поддиректорий
+// Recursive-источника приводят к одному и тому же targetPath (и, соответственно, одному и тому
+// же временному файлу-спутнику в moveFile), без этой сериализации два воркера могли бы
+// одновременно открыть один tmp-файл и испортить копирование друг друга. Дождавшись своей
+// очереди, воркер переносит файл как обычно — если targetPath уже занят настоящим, завершённым
+// файлом, а не другим воркером в очереди, moveFile отклонит перенос привычной ошибкой
+// "целевой файл уже существует", не оставляя исходный файл без внимания молча.
+func (pool *pairWorkerPool) claimTarget(targetPath string) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for pool.inFlight[targetPath] {
+		pool.cond.Wait()
+	}
+	pool.inFlight[targetPath] = true
+}
+
+// releaseTarget снимает резервацию targetPath, сделанную claimTarget, и будит воркеров,
+// ожидающих этот же targetPath.
+func (pool *pairWorkerPool) releaseTarget(targetPath string) {
+	pool.mu.Lock()
+	delete(pool.inFlight, targetPath)
+	pool.mu.Unlock()
+	pool.cond.Broadcast()
+}
+
+// Submit ставит job в очередь пула. Блокируется, если все воркеры заняты.
+func (pool *pairWorkerPool) Submit(job moveJob) {
+	pool.jobs <- job
+}
+
+// Close закрывает очередь и дожидается завершения всех запущенных воркеров.
+func (pool *pairWorkerPool) Close() {
+	close(pool.jobs)
+	pool.wg.Wait()
+}
+
+// runMoveJob выполняет один перенос файла, логируя начало и конец с достигнутой пропускной
+// способностью. Перед переносом targetPath резервируется в pool: если два файла с одинаковым
+// именем из разных поддиректорий Recursive-источника переносятся одновременно, второй дожидается
+// завершения первого вместо того, чтобы переноситься параллельно в один и тот же целевой путь
+// (см. claimTarget).
+func runMoveJob(job moveJob, pair Pair, limiter *rate.Limiter, lg *logger.Logger, pool *pairWorkerPool) {
+	targetPath := filepath.Join(pair.TargetDir, job.info.Name())
+
+	pool.claimTarget(targetPath)
+	defer pool.releaseTarget(targetPath)
+
+	lg.Info("Перенос начат", logger.Src(job.path), logger.Dst(targetPath), logger.Bytes(job.info.Size()))
+
+	start := time.Now()
+	if err := moveFile(job.path, targetPath, pair.DeleteSourceAfter, limiter, lg); err != nil {
+		lg.Error("Ошибка при перемещении файла", logger.Src(job.path), logger.Dst(targetPath), logger.Err(err))
+		return
+	}
+
+	duration := time.Since(start)
+	lg.Info("Файл перемещен", logger.Src(job.path), logger.Dst(targetPath),
+		logger.Bytes(job.info.Size()), logger.Duration(duration), logger.BytesPerSec(throughput(job.info.Size(), duration)))
+}
+
+// throughput вычисляет среднюю скорость переноса в байтах в секунду.
+func throughput(size int64, d time.Duration) int64 {
+	seconds := d.Seconds()
+	if seconds <= 0 {
+		return 0
+	}
+	return int64(float64(size) / seconds)
+}